@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// flexibleDateLayout - допустимый формат даты без времени для query-параметров
+const flexibleDateLayout = "2006-01-02"
+
+// defaultSlotDuration используется, когда клиент не передал duration
+const defaultSlotDuration = 30 * time.Minute
+
+type freeSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type roomAvailability struct {
+	RoomID    int64      `json:"room_id"`
+	Name      string     `json:"name"`
+	FreeSlots []freeSlot `json:"free_slots"`
+}
+
+type availabilityResponse struct {
+	Rooms []roomAvailability `json:"rooms"`
+}
+
+// parseFlexibleTime разбирает момент времени в формате RFC3339 либо
+// просто дату (2006-01-02, полночь UTC) - так клиентам не обязательно
+// знать точное время при грубом поиске доступности.
+func parseFlexibleTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(flexibleDateLayout, raw)
+}
+
+// handleAvailability ищет свободные окна нужной длительности во всех
+// комнатах, вмещающих capacity человек, в пределах [start, end).
+func (a *App) handleAvailability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	startRaw := q.Get("start")
+	endRaw := q.Get("end")
+	capacityRaw := q.Get("capacity")
+	if startRaw == "" || endRaw == "" || capacityRaw == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "start, end and capacity are required"})
+		return
+	}
+
+	start, err := parseFlexibleTime(startRaw)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "start must be RFC3339 or YYYY-MM-DD"})
+		return
+	}
+	end, err := parseFlexibleTime(endRaw)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "end must be RFC3339 or YYYY-MM-DD"})
+		return
+	}
+	if !end.After(start) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "end must be after start"})
+		return
+	}
+
+	capacity, err := strconvAtoiPositive(capacityRaw)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "capacity must be a positive integer"})
+		return
+	}
+
+	duration := defaultSlotDuration
+	if durationRaw := q.Get("duration"); durationRaw != "" {
+		minutes, err := strconvAtoiPositive(durationRaw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "duration must be a positive integer (minutes)"})
+			return
+		}
+		duration = time.Duration(minutes) * time.Minute
+	}
+
+	user := a.optionalAuthUser(r)
+
+	var rows *sql.Rows
+	if user != nil && user.Role == "admin" {
+		rows, err = a.DB.Query(
+			`SELECT id, name FROM rooms WHERE is_active = true AND capacity >= $1 ORDER BY id`,
+			capacity,
+		)
+	} else {
+		var userID int64
+		if user != nil {
+			userID = user.ID
+		}
+		rows, err = a.DB.Query(
+			`SELECT id, name FROM rooms
+             WHERE is_active = true AND capacity >= $1
+               AND (visibility = 'public' OR id IN (SELECT room_id FROM room_members WHERE user_id = $2))
+             ORDER BY id`,
+			capacity, userID,
+		)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+
+	type candidateRoom struct {
+		id   int64
+		name string
+	}
+	var candidates []candidateRoom
+	for rows.Next() {
+		var room candidateRoom
+		if err := rows.Scan(&room.id, &room.name); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+		candidates = append(candidates, room)
+	}
+
+	resp := availabilityResponse{Rooms: []roomAvailability{}}
+	for _, room := range candidates {
+		bookingRows, err := a.DB.Query(
+			`SELECT start_time, end_time
+             FROM bookings
+             WHERE room_id = $1
+               AND status != 'cancelled'
+               AND start_time < $3 AND end_time > $2
+             ORDER BY start_time`,
+			room.id, start, end,
+		)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+
+		var busy []freeSlot
+		for bookingRows.Next() {
+			var b freeSlot
+			if err := bookingRows.Scan(&b.Start, &b.End); err != nil {
+				bookingRows.Close()
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+				return
+			}
+			busy = append(busy, b)
+		}
+		bookingRows.Close()
+
+		free := freeSlotsInWindow(start, end, busy, duration)
+		resp.Rooms = append(resp.Rooms, roomAvailability{
+			RoomID:    room.id,
+			Name:      room.name,
+			FreeSlots: free,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// freeSlotsInWindow идет по окну [start, end), вычитая занятые интервалы
+// (уже отсортированные по start_time), и возвращает промежутки длиной
+// не меньше minDuration.
+func freeSlotsInWindow(start, end time.Time, busy []freeSlot, minDuration time.Duration) []freeSlot {
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+
+	var free []freeSlot
+	cursor := start
+	for _, b := range busy {
+		if b.Start.After(cursor) {
+			if gap := b.Start.Sub(cursor); gap >= minDuration {
+				free = append(free, freeSlot{Start: cursor, End: b.Start})
+			}
+		}
+		if b.End.After(cursor) {
+			cursor = b.End
+		}
+	}
+	if end.Sub(cursor) >= minDuration {
+		free = append(free, freeSlot{Start: cursor, End: end})
+	}
+	return free
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// errTimeSlotConflict - сигнальная ошибка для fn внутри
+// withSerializableTx: говорит вызывающему коду, что нужно ответить
+// 409, не выполняя INSERT.
+var errTimeSlotConflict = errors.New("time slot already booked")
+
+// Postgres SQLSTATE коды, на которые опирается withSerializableTx.
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+	pgExclusionViolation   = "23P01"
+)
+
+// maxSerializableRetries - сколько раз повторить транзакцию при
+// конфликте сериализации/дедлоке, прежде чем сдаться.
+const maxSerializableRetries = 3
+
+func pgErrorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
+
+func isExclusionViolation(err error) bool {
+	return pgErrorCode(err) == pgExclusionViolation
+}
+
+func isRetryableTxError(err error) bool {
+	switch pgErrorCode(err) {
+	case pgSerializationFailure, pgDeadlockDetected:
+		return true
+	default:
+		return false
+	}
+}
+
+// withSerializableTx выполняет fn внутри транзакции с уровнем
+// изоляции SERIALIZABLE, повторяя ее при 40001/40P01 (конфликт
+// сериализации/дедлок) до maxSerializableRetries раз. Это нужно, чтобы
+// "check, затем insert" было атомарным под нагрузкой: сам по себе
+// SELECT count(*) перед INSERT не исключает гонку двух параллельных
+// запросов на один и тот же слот.
+func (a *App) withSerializableTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var lastErr error
+	for attempt := 0; attempt <= maxSerializableRetries; attempt++ {
+		lastErr = a.runInTx(ctx, fn)
+		if lastErr == nil {
+			return nil
+		}
+		if !isRetryableTxError(lastErr) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// writeBookingConflictOrError maps the outcome of a booking
+// check+insert transaction to an HTTP response: a plain 409 for the
+// advisory check, or - if the race slipped past it - a 409 with the
+// conflicting booking's id once the EXCLUDE constraint rejects the
+// INSERT (23P01).
+func (a *App) writeBookingConflictOrError(w http.ResponseWriter, roomID int64, start, end time.Time, err error) {
+	if errors.Is(err, errTimeSlotConflict) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "time slot already booked"})
+		return
+	}
+	if isExclusionViolation(err) {
+		var conflictingID int64
+		lookupErr := a.DB.QueryRow(
+			`SELECT id FROM bookings
+             WHERE room_id = $1
+               AND status IN ('pending', 'confirmed')
+               AND NOT ($3 <= start_time OR $2 >= end_time)
+             LIMIT 1`,
+			roomID, start, end,
+		).Scan(&conflictingID)
+		if lookupErr != nil {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "conflict"})
+			return
+		}
+		writeJSON(w, http.StatusConflict, map[string]any{"error": "conflict", "conflicting_booking_id": conflictingID})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+}
+
+func (a *App) runInTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := a.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const icsTimeLayout = "20060102T150405Z"
+
+// icsEvent - одно вхождение VEVENT.
+type icsEvent struct {
+	UID       string
+	Start     time.Time
+	End       time.Time
+	Summary   string
+	Organizer string
+	Sequence  int
+	Status    string // CONFIRMED | CANCELLED
+}
+
+func bookingUID(bookingID int64) string {
+	return fmt.Sprintf("booking-%d@bookmyroom", bookingID)
+}
+
+// icsEscape экранирует запятые, точки с запятой и переводы строк по
+// RFC 5545 §3.3.11.
+func icsEscape(s string) string {
+	replacer := strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\n", "\\n",
+	)
+	return replacer.Replace(s)
+}
+
+// buildVCalendar собирает text/calendar документ. method пустой
+// означает обычную фид-подписку (GET .../bookings.ics); REQUEST/CANCEL
+// используются для писем-приглашений, отправляемых Notifier'ом.
+func buildVCalendar(method string, events []icsEvent) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//bookmyroom//EN\r\n")
+	if method != "" {
+		fmt.Fprintf(&b, "METHOD:%s\r\n", method)
+	}
+	for _, e := range events {
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:%s\r\n", e.UID)
+		fmt.Fprintf(&b, "DTSTART:%s\r\n", e.Start.UTC().Format(icsTimeLayout))
+		fmt.Fprintf(&b, "DTEND:%s\r\n", e.End.UTC().Format(icsTimeLayout))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icsEscape(e.Summary))
+		if e.Organizer != "" {
+			fmt.Fprintf(&b, "ORGANIZER:mailto:%s\r\n", e.Organizer)
+		}
+		fmt.Fprintf(&b, "SEQUENCE:%d\r\n", e.Sequence)
+		if e.Status != "" {
+			fmt.Fprintf(&b, "STATUS:%s\r\n", e.Status)
+		}
+		b.WriteString("END:VEVENT\r\n")
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+func writeICS(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(body))
+}
+
+// handleRoomBookingsICS отдает подписываемый фид всех неотмененных
+// броней комнаты.
+func (a *App) handleRoomBookingsICS(w http.ResponseWriter, r *http.Request) {
+	roomID, err := parseIDParam(r, "roomID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return
+	}
+
+	allowed, err := a.canAccessRoom(a.optionalAuthUser(r), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "room not found"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		}
+		return
+	}
+	if !allowed {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "access denied"})
+		return
+	}
+
+	var roomName string
+	if err := a.DB.QueryRow(`SELECT name FROM rooms WHERE id = $1`, roomID).Scan(&roomName); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	rows, err := a.DB.Query(
+		`SELECT b.id, b.start_time, b.end_time, b.sequence, u.email
+         FROM bookings b
+         JOIN users u ON u.id = b.user_id
+         WHERE b.room_id = $1 AND b.status != 'cancelled'
+         ORDER BY b.start_time`,
+		roomID,
+	)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+
+	var events []icsEvent
+	for rows.Next() {
+		var id int64
+		var start, end time.Time
+		var sequence int
+		var organizer string
+		if err := rows.Scan(&id, &start, &end, &sequence, &organizer); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+		events = append(events, icsEvent{
+			UID:       bookingUID(id),
+			Start:     start,
+			End:       end,
+			Summary:   roomName,
+			Organizer: organizer,
+			Sequence:  sequence,
+		})
+	}
+
+	writeICS(w, buildVCalendar("", events))
+}
+
+// handleMyBookingsICS отдает персональный фид текущего пользователя.
+// Календарные клиенты опрашивают подписанный URL по собственному
+// расписанию и не могут передать заголовок Authorization, поэтому
+// вместо короткоживущего access-JWT используется отдельный бессрочный
+// (но отзываемый) токен ICS-фида - выдается POST /api/bookings/my.ics/token,
+// см. icsfeedtoken.go - и принимается через query-параметр ?token=.
+func (a *App) handleMyBookingsICS(w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.URL.Query().Get("token")
+	if tokenStr == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "token required"})
+		return
+	}
+	user, err := a.resolveICSFeedToken(tokenStr)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+
+	rows, err := a.DB.Query(
+		`SELECT b.id, b.start_time, b.end_time, b.sequence, r.name, u.email
+         FROM bookings b
+         JOIN rooms r ON r.id = b.room_id
+         JOIN users u ON u.id = b.user_id
+         WHERE b.user_id = $1 AND b.status != 'cancelled'
+         ORDER BY b.start_time`,
+		user.ID,
+	)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+
+	var events []icsEvent
+	for rows.Next() {
+		var id int64
+		var start, end time.Time
+		var sequence int
+		var roomName, organizer string
+		if err := rows.Scan(&id, &start, &end, &sequence, &roomName, &organizer); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+		events = append(events, icsEvent{
+			UID:       bookingUID(id),
+			Start:     start,
+			End:       end,
+			Summary:   roomName,
+			Organizer: organizer,
+			Sequence:  sequence,
+		})
+	}
+
+	writeICS(w, buildVCalendar("", events))
+}
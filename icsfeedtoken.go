@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// ics_feed_tokens - таблица отдельных бессрочных (но отзываемых)
+// токенов персонального ICS-фида: (user_id, token_hash, created_at,
+// revoked_at). Почтовые/календарные клиенты опрашивают подписанный URL
+// по собственному расписанию, обычно заметно реже, чем раз в
+// accessTokenTTL (15 минут), поэтому короткоживущий access-JWT сюда не
+// подходит - ссылка, вставленная в Outlook/Google/Apple Calendar,
+// переставала бы работать почти сразу после выдачи.
+//
+// Хранится только hash токена - так же, как и для refresh-токенов
+// (см. tokens.go), чтобы утечка БД не раскрывала сами токены.
+
+// generateICSFeedSecret возвращает случайный токен персонального
+// ICS-фида, который отдается клиенту.
+func generateICSFeedSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// issueICSFeedToken выпускает новый токен ICS-фида для userID. Старые
+// токены пользователя не отзываются - так подписка, уже вставленная в
+// один календарный клиент, не ломается при выдаче ссылки для другого.
+func (a *App) issueICSFeedToken(userID int64) (string, error) {
+	raw, err := generateICSFeedSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = a.DB.Exec(
+		`INSERT INTO ics_feed_tokens (user_id, token_hash) VALUES ($1, $2)`,
+		userID, hashRefreshToken(raw),
+	)
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// resolveICSFeedToken ищет пользователя по предъявленному токену
+// ICS-фида. Токен бессрочный, но перестает работать сразу после
+// отзыва (revoked_at).
+func (a *App) resolveICSFeedToken(raw string) (*AuthUser, error) {
+	var user AuthUser
+	err := a.DB.QueryRow(
+		`SELECT t.user_id, u.role
+         FROM ics_feed_tokens t
+         JOIN users u ON u.id = t.user_id
+         WHERE t.token_hash = $1 AND t.revoked_at IS NULL`,
+		hashRefreshToken(raw),
+	).Scan(&user.ID, &user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// handleCreateICSFeedToken выпускает новый токен для персонального
+// ICS-фида текущего пользователя - подставляется в .../bookings/my.ics?token=...
+func (a *App) handleCreateICSFeedToken(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	token, err := a.issueICSFeedToken(user.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"feed_token": token})
+}
@@ -34,6 +34,7 @@ type Room struct {
 	Capacity    int       `json:"capacity"`
 	PhotoURL    string    `json:"photo_url,omitempty"`
 	IsActive    bool      `json:"is_active"`
+	Visibility  string    `json:"visibility"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -44,9 +45,21 @@ type Booking struct {
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 	Status    string    `json:"status"`
+	SeriesID  *int64    `json:"series_id,omitempty"`
+	RRule     string    `json:"rrule,omitempty"`
+	Sequence  int       `json:"sequence"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// validBookingStatuses - допустимые значения Booking.Status. handleUpdateBooking
+// сверяется с этим набором, прежде чем сохранить статус в БД - он
+// попадает не только в ответ API, но и в Subject письма-приглашения.
+var validBookingStatuses = map[string]bool{
+	"pending":   true,
+	"confirmed": true,
+	"cancelled": true,
+}
+
 // запросы/ответы
 
 type registerRequest struct {
@@ -60,7 +73,8 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type createRoomRequest struct {
@@ -68,16 +82,20 @@ type createRoomRequest struct {
 	Description string `json:"description"`
 	Capacity    int    `json:"capacity"`
 	PhotoURL    string `json:"photo_url"`
+	Visibility  string `json:"visibility,omitempty"` // public (default) | private | invite-only
 }
 
 type createBookingRequest struct {
-	RoomID    int64  `json:"room_id"`
-	StartTime string `json:"start_time"` // RFC3339
-	EndTime   string `json:"end_time"`   // RFC3339
+	RoomID     int64  `json:"room_id"`
+	StartTime  string `json:"start_time"`          // RFC3339
+	EndTime    string `json:"end_time"`            // RFC3339
+	Recurrence string `json:"recurrence,omitempty"` // опциональный RRULE, напр. "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"
 }
 
 type updateBookingRequest struct {
-	Status string `json:"status"`
+	Status    string `json:"status"`
+	StartTime string `json:"start_time,omitempty"` // RFC3339, только для admin-переноса брони
+	EndTime   string `json:"end_time,omitempty"`   // RFC3339, только для admin-переноса брони
 }
 
 // Auth в контексте
@@ -102,8 +120,13 @@ type Claims struct {
 // глобальный state прототипа
 
 type App struct {
-	DB        *sql.DB
-	JWTSecret []byte
+	DB                       *sql.DB
+	JWTKeys                  map[string][]byte // kid -> signing key, позволяет ротацию без инвалидации всех сессий
+	JWTActiveKid             string
+	MaxRecurrenceOccurrences int
+	Hub                      *Hub
+	RevokedJTIs              *revokedJTICache
+	Notifier                 Notifier
 }
 
 func main() {
@@ -111,9 +134,9 @@ func main() {
 	if dsn == "" {
 		log.Fatal("DB_DSN is not set")
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is not set")
+	jwtKeys, activeKid, err := loadJWTKeys()
+	if err != nil {
+		log.Fatalf("jwt keys: %v", err)
 	}
 
 	db, err := sql.Open("postgres", dsn)
@@ -126,9 +149,21 @@ func main() {
 		log.Fatalf("ping db: %v", err)
 	}
 
+	maxRecurrenceOccurrences := 365
+	if raw := os.Getenv("RRULE_MAX_OCCURRENCES"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			maxRecurrenceOccurrences = n
+		}
+	}
+
 	app := &App{
-		DB:        db,
-		JWTSecret: []byte(jwtSecret),
+		DB:                       db,
+		JWTKeys:                  jwtKeys,
+		JWTActiveKid:             activeKid,
+		MaxRecurrenceOccurrences: maxRecurrenceOccurrences,
+		Hub:                      newHub(),
+		RevokedJTIs:              newRevokedJTICache(revokedJTICacheSize),
+		Notifier:                 newNotifier(),
 	}
 
 	r := chi.NewRouter()
@@ -138,20 +173,36 @@ func main() {
 	// Публичные эндпоинты
 	r.Post("/api/register", app.handleRegister)
 	r.Post("/api/login", app.handleLogin)
+	r.Post("/api/refresh", app.handleRefresh)
+	r.Post("/api/logout", app.handleLogout)
 
 	// Публичный просмотр комнат и расписаний
 	r.Get("/api/rooms", app.handleListRooms)
 	r.Get("/api/rooms/{roomID}", app.handleGetRoom)
 	r.Get("/api/rooms/{roomID}/bookings", app.handleRoomBookings)
+	r.Get("/api/rooms/{roomID}/bookings.ics", app.handleRoomBookingsICS)
+	r.Get("/api/bookings/my.ics", app.handleMyBookingsICS)
+	r.Get("/api/availability", app.handleAvailability)
+	r.Get("/api/ws", app.handleWS)
 
 	// Защищенные маршруты
 	r.Group(func(pr chi.Router) {
 		pr.Use(app.authMiddleware)
 
 		pr.Get("/api/bookings/my", app.handleMyBookings)
+		pr.Post("/api/bookings/my.ics/token", app.handleCreateICSFeedToken)
 		pr.Post("/api/bookings", app.handleCreateBooking)
 		pr.Patch("/api/bookings/{bookingID}", app.handleUpdateBooking)
 		pr.Delete("/api/bookings/{bookingID}", app.handleCancelBooking)
+		pr.Delete("/api/bookings/series/{seriesID}", app.handleCancelBookingSeries)
+
+		pr.Get("/api/rooms/{roomID}/me", app.handleRoomMe)
+		pr.Group(func(mr chi.Router) {
+			mr.Use(app.requireRoomPermission(PermissionManageMembers))
+			mr.Post("/api/rooms/{roomID}/members", app.handleAddRoomMember)
+			mr.Patch("/api/rooms/{roomID}/members/{userID}", app.handleUpdateRoomMember)
+			mr.Delete("/api/rooms/{roomID}/members/{userID}", app.handleRemoveRoomMember)
+		})
 
 		// Admin
 		pr.Group(func(ar chi.Router) {
@@ -205,8 +256,102 @@ func parseIDParam(r *http.Request, name string) (int64, error) {
 	return id, nil
 }
 
+// strconvAtoiPositive парсит строку как положительное целое число,
+// используется для числовых query-параметров
+func strconvAtoiPositive(raw string) (int, error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, errors.New("must be a positive integer")
+	}
+	return n, nil
+}
+
+func (a *App) userEmail(userID int64) (string, error) {
+	var email string
+	err := a.DB.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	return email, err
+}
+
+func (a *App) roomName(roomID int64) (string, error) {
+	var name string
+	err := a.DB.QueryRow(`SELECT name FROM rooms WHERE id = $1`, roomID).Scan(&name)
+	return name, err
+}
+
+// sendBookingInvite строит VCALENDAR для одной брони и передает его
+// Notifier'у - используется при создании/изменении/отмене брони.
+func (a *App) sendBookingInvite(booking Booking, method string) {
+	organizer, err := a.userEmail(booking.UserID)
+	if err != nil {
+		log.Printf("booking invite: lookup user email: %v", err)
+		return
+	}
+	roomName, err := a.roomName(booking.RoomID)
+	if err != nil {
+		log.Printf("booking invite: lookup room name: %v", err)
+		return
+	}
+
+	status := "CONFIRMED"
+	if booking.Status == "cancelled" {
+		status = "CANCELLED"
+	}
+	ics := buildVCalendar(method, []icsEvent{{
+		UID:       bookingUID(booking.ID),
+		Start:     booking.StartTime,
+		End:       booking.EndTime,
+		Summary:   roomName,
+		Organizer: organizer,
+		Sequence:  booking.Sequence,
+		Status:    status,
+	}})
+
+	if err := a.Notifier.SendBookingEmail(context.Background(), booking, organizer, method, ics); err != nil {
+		log.Printf("booking invite: send: %v", err)
+	}
+}
+
 // ===== Auth middleware =====
 
+// parseAccessToken проверяет подпись и срок действия access-токена и
+// возвращает связанного с ним пользователя. Используется как HTTP
+// auth middleware, так и апгрейдом WebSocket-соединения.
+func (a *App) parseAccessToken(tokenStr string) (*AuthUser, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := a.JWTKeys[kid]
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if claims.ID != "" && a.RevokedJTIs.isRevoked(claims.ID) {
+		return nil, errors.New("token revoked")
+	}
+	return &AuthUser{ID: claims.UserID, Role: claims.Role}, nil
+}
+
+// optionalAuthUser пытается разобрать Bearer-токен из запроса, но не
+// требует его наличия - используется публичными маршрутами, которым
+// все же нужно знать личность пользователя, если он аутентифицирован
+// (например, чтобы проверить членство в приватной комнате).
+func (a *App) optionalAuthUser(r *http.Request) *AuthUser {
+	header := r.Header.Get("Authorization")
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil
+	}
+	user, err := a.parseAccessToken(parts[1])
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
 func (a *App) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		header := r.Header.Get("Authorization")
@@ -221,20 +366,12 @@ func (a *App) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		tokenStr := parts[1]
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return a.JWTSecret, nil
-		})
-		if err != nil || !token.Valid {
+		user, err := a.parseAccessToken(parts[1])
+		if err != nil {
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Токен не найден"})
 			return
 		}
 
-		user := &AuthUser{
-			ID:   claims.UserID,
-			Role: claims.Role,
-		}
 		ctx := context.WithValue(r.Context(), userCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -334,29 +471,40 @@ func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims := &Claims{
-		UserID: id,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString(a.JWTSecret)
+	accessToken, refreshToken, err := a.issueTokenPair(r, id, role)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Токен не существует"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, loginResponse{Token: tokenStr})
+	writeJSON(w, http.StatusOK, loginResponse{Token: accessToken, RefreshToken: refreshToken})
 }
 
 // ===== Handlers: rooms =====
 
+// handleListRooms отдает все публичные комнаты плюс те
+// private/invite-only комнаты, участником которых является вызывающий
+// (или все комнаты без ограничений, если вызывающий - admin).
 func (a *App) handleListRooms(w http.ResponseWriter, r *http.Request) {
-	rows, err := a.DB.Query(`SELECT id, name, description, capacity, photo_url, is_active, created_at FROM rooms ORDER BY id`)
+	user := a.optionalAuthUser(r)
+
+	var rows *sql.Rows
+	var err error
+	if user != nil && user.Role == "admin" {
+		rows, err = a.DB.Query(`SELECT id, name, description, capacity, photo_url, is_active, visibility, created_at FROM rooms ORDER BY id`)
+	} else {
+		var userID int64
+		if user != nil {
+			userID = user.ID
+		}
+		rows, err = a.DB.Query(
+			`SELECT id, name, description, capacity, photo_url, is_active, visibility, created_at
+             FROM rooms
+             WHERE visibility = 'public' OR id IN (SELECT room_id FROM room_members WHERE user_id = $1)
+             ORDER BY id`,
+			userID,
+		)
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
 		return
@@ -366,7 +514,7 @@ func (a *App) handleListRooms(w http.ResponseWriter, r *http.Request) {
 	var rooms []Room
 	for rows.Next() {
 		var room Room
-		if err := rows.Scan(&room.ID, &room.Name, &room.Description, &room.Capacity, &room.PhotoURL, &room.IsActive, &room.CreatedAt); err != nil {
+		if err := rows.Scan(&room.ID, &room.Name, &room.Description, &room.Capacity, &room.PhotoURL, &room.IsActive, &room.Visibility, &room.CreatedAt); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
 			return
 		}
@@ -383,13 +531,27 @@ func (a *App) handleGetRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := a.canAccessRoom(a.optionalAuthUser(r), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "room not found"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		}
+		return
+	}
+	if !allowed {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "access denied"})
+		return
+	}
+
 	var room Room
 	err = a.DB.QueryRow(
-		`SELECT id, name, description, capacity, photo_url, is_active, created_at
+		`SELECT id, name, description, capacity, photo_url, is_active, visibility, created_at
          FROM rooms
          WHERE id = $1`,
 		roomID,
-	).Scan(&room.ID, &room.Name, &room.Description, &room.Capacity, &room.PhotoURL, &room.IsActive, &room.CreatedAt)
+	).Scan(&room.ID, &room.Name, &room.Description, &room.Capacity, &room.PhotoURL, &room.IsActive, &room.Visibility, &room.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "room not found"})
@@ -413,11 +575,19 @@ func (a *App) handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name and capacity > 0 required"})
 		return
 	}
+	req.Visibility = strings.ToLower(strings.TrimSpace(req.Visibility))
+	if req.Visibility == "" {
+		req.Visibility = RoomVisibilityPublic
+	}
+	if req.Visibility != RoomVisibilityPublic && req.Visibility != RoomVisibilityPrivate && req.Visibility != RoomVisibilityInviteOnly {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported visibility: " + req.Visibility})
+		return
+	}
 
 	var id int64
 	err := a.DB.QueryRow(
-		`INSERT INTO rooms (name, description, capacity, photo_url) VALUES ($1, $2, $3, $4) RETURNING id`,
-		req.Name, req.Description, req.Capacity, req.PhotoURL,
+		`INSERT INTO rooms (name, description, capacity, photo_url, visibility) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		req.Name, req.Description, req.Capacity, req.PhotoURL, req.Visibility,
 	).Scan(&id)
 
 	if err != nil {
@@ -439,17 +609,27 @@ func (a *App) handleUpdateRoom(w http.ResponseWriter, r *http.Request) {
 	if !readJSON(w, r, &req) {
 		return
 	}
+	req.Visibility = strings.ToLower(strings.TrimSpace(req.Visibility))
+	if req.Visibility == "" {
+		req.Visibility = RoomVisibilityPublic
+	}
+	if req.Visibility != RoomVisibilityPublic && req.Visibility != RoomVisibilityPrivate && req.Visibility != RoomVisibilityInviteOnly {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported visibility: " + req.Visibility})
+		return
+	}
 
 	// простое обновление всех полей
 	_, err = a.DB.Exec(
-		`UPDATE rooms SET name = $1, description = $2, capacity = $3, photo_url = $4 WHERE id = $5`,
-		req.Name, req.Description, req.Capacity, req.PhotoURL, roomID,
+		`UPDATE rooms SET name = $1, description = $2, capacity = $3, photo_url = $4, visibility = $5 WHERE id = $6`,
+		req.Name, req.Description, req.Capacity, req.PhotoURL, req.Visibility, roomID,
 	)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
 		return
 	}
 
+	a.Hub.broadcast(roomID, wsEvent{Type: "room.updated", RoomID: roomID})
+
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
@@ -476,9 +656,23 @@ func (a *App) handleRoomBookings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := a.canAccessRoom(a.optionalAuthUser(r), roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "room not found"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		}
+		return
+	}
+	if !allowed {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "access denied"})
+		return
+	}
+
 	rows, err := a.DB.Query(
-		`SELECT id, room_id, user_id, start_time, end_time, status, created_at 
-         FROM bookings 
+		`SELECT id, room_id, user_id, start_time, end_time, status, series_id, rrule, sequence, created_at
+         FROM bookings
          WHERE room_id = $1 AND status != 'cancelled'
          ORDER BY start_time`,
 		roomID,
@@ -492,10 +686,12 @@ func (a *App) handleRoomBookings(w http.ResponseWriter, r *http.Request) {
 	var res []Booking
 	for rows.Next() {
 		var b Booking
-		if err := rows.Scan(&b.ID, &b.RoomID, &b.UserID, &b.StartTime, &b.EndTime, &b.Status, &b.CreatedAt); err != nil {
+		var rrule sql.NullString
+		if err := rows.Scan(&b.ID, &b.RoomID, &b.UserID, &b.StartTime, &b.EndTime, &b.Status, &b.SeriesID, &rrule, &b.Sequence, &b.CreatedAt); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
 			return
 		}
+		b.RRule = rrule.String
 		res = append(res, b)
 	}
 
@@ -521,6 +717,20 @@ func (a *App) handleCreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := a.canAccessRoom(user, req.RoomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "room not found"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		}
+		return
+	}
+	if !allowed {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "access denied"})
+		return
+	}
+
 	start, err := time.Parse(time.RFC3339, req.StartTime)
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Начало не распознано"})
@@ -536,38 +746,55 @@ func (a *App) handleCreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// проверяем пересечение с существующими подтвержденными или ожидающими
-	var cnt int
-	err = a.DB.QueryRow(
-		`SELECT count(*) 
-         FROM bookings 
-         WHERE room_id = $1 
-           AND status IN ('pending', 'confirmed')
-           AND NOT ($3 <= start_time OR $2 >= end_time)`,
-		req.RoomID, start, end,
-	).Scan(&cnt)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
-		return
-	}
-	if cnt > 0 {
-		writeJSON(w, http.StatusConflict, map[string]string{"error": "time slot already booked"})
+	if req.Recurrence != "" {
+		a.createRecurringBooking(w, r, user, req.RoomID, start, end, req.Recurrence)
 		return
 	}
 
+	// Пересечение слотов - это gist EXCLUDE constraint на bookings
+	// (room_id WITH =, tstzrange(start_time, end_time, '[)') WITH &&
+	// WHERE status IN ('pending','confirmed')), см. миграцию в репозитории
+	// инфраструктуры БД. SELECT ниже - это только быстрый путь для
+	// дружелюбной ошибки; настоящая защита от гонки - сам constraint,
+	// который проверяем через 23P01 после INSERT.
 	var bookingID int64
-	err = a.DB.QueryRow(
-		`INSERT INTO bookings (room_id, user_id, start_time, end_time, status) 
-         VALUES ($1, $2, $3, $4, 'confirmed') RETURNING id`,
-		req.RoomID, user.ID, start, end,
-	).Scan(&bookingID)
+	err = a.withSerializableTx(r.Context(), func(tx *sql.Tx) error {
+		var cnt int
+		if err := tx.QueryRow(
+			`SELECT count(*)
+             FROM bookings
+             WHERE room_id = $1
+               AND status IN ('pending', 'confirmed')
+               AND NOT ($3 <= start_time OR $2 >= end_time)`,
+			req.RoomID, start, end,
+		).Scan(&cnt); err != nil {
+			return err
+		}
+		if cnt > 0 {
+			return errTimeSlotConflict
+		}
+
+		return tx.QueryRow(
+			`INSERT INTO bookings (room_id, user_id, start_time, end_time, status)
+             VALUES ($1, $2, $3, $4, 'confirmed') RETURNING id`,
+			req.RoomID, user.ID, start, end,
+		).Scan(&bookingID)
+	})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		a.writeBookingConflictOrError(w, req.RoomID, start, end, err)
 		return
 	}
 
-	// Email-уведомление в прототипе просто логируем
-	log.Printf("[email] booking confirmed: booking_id=%d user_id=%d room_id=%d", bookingID, user.ID, req.RoomID)
+	a.sendBookingInvite(Booking{
+		ID: bookingID, RoomID: req.RoomID, UserID: user.ID,
+		StartTime: start, EndTime: end, Status: "confirmed",
+	}, "REQUEST")
+
+	a.Hub.broadcast(req.RoomID, wsEvent{
+		Type:   "booking.created",
+		RoomID: req.RoomID,
+		Data:   map[string]any{"id": bookingID, "start_time": start, "end_time": end},
+	})
 
 	writeJSON(w, http.StatusCreated, map[string]any{"id": bookingID})
 }
@@ -580,7 +807,7 @@ func (a *App) handleMyBookings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rows, err := a.DB.Query(
-		`SELECT id, room_id, user_id, start_time, end_time, status, created_at
+		`SELECT id, room_id, user_id, start_time, end_time, status, series_id, rrule, sequence, created_at
          FROM bookings
          WHERE user_id = $1
          ORDER BY start_time DESC`,
@@ -595,10 +822,12 @@ func (a *App) handleMyBookings(w http.ResponseWriter, r *http.Request) {
 	var res []Booking
 	for rows.Next() {
 		var b Booking
-		if err := rows.Scan(&b.ID, &b.RoomID, &b.UserID, &b.StartTime, &b.EndTime, &b.Status, &b.CreatedAt); err != nil {
+		var rrule sql.NullString
+		if err := rows.Scan(&b.ID, &b.RoomID, &b.UserID, &b.StartTime, &b.EndTime, &b.Status, &b.SeriesID, &rrule, &b.Sequence, &b.CreatedAt); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
 			return
 		}
+		b.RRule = rrule.String
 		res = append(res, b)
 	}
 
@@ -627,10 +856,20 @@ func (a *App) handleUpdateBooking(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "status required"})
 		return
 	}
+	if !validBookingStatuses[req.Status] {
+		// Статус попадает прямо в Subject письма-приглашения
+		// (sendBookingInvite), поэтому произвольная строка здесь - это
+		// не только некорректные данные, но и риск инъекции заголовков
+		// в исходящее письмо.
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported status: " + req.Status})
+		return
+	}
 
 	// Разрешим пользователю менять только свои брони, admin может любые
-	var ownerID int64
-	err = a.DB.QueryRow(`SELECT user_id FROM bookings WHERE id = $1`, bookingID).Scan(&ownerID)
+	var ownerID, roomID int64
+	var startTime, endTime time.Time
+	err = a.DB.QueryRow(`SELECT user_id, room_id, start_time, end_time FROM bookings WHERE id = $1`, bookingID).
+		Scan(&ownerID, &roomID, &startTime, &endTime)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "booking not found"})
@@ -645,15 +884,78 @@ func (a *App) handleUpdateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = a.DB.Exec(
-		`UPDATE bookings SET status = $1 WHERE id = $2`,
-		req.Status, bookingID,
-	)
+	reschedule := req.StartTime != "" || req.EndTime != ""
+	if reschedule {
+		if user.Role != "admin" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "only admin can reschedule a booking"})
+			return
+		}
+		if req.StartTime != "" {
+			startTime, err = time.Parse(time.RFC3339, req.StartTime)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid start_time"})
+				return
+			}
+		}
+		if req.EndTime != "" {
+			endTime, err = time.Parse(time.RFC3339, req.EndTime)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid end_time"})
+				return
+			}
+		}
+		if !endTime.After(startTime) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "end_time must be after start_time"})
+			return
+		}
+	}
+
+	var sequence int
+	err = a.withSerializableTx(r.Context(), func(tx *sql.Tx) error {
+		if reschedule {
+			var cnt int
+			if err := tx.QueryRow(
+				`SELECT count(*)
+                 FROM bookings
+                 WHERE room_id = $1
+                   AND id != $2
+                   AND status IN ('pending', 'confirmed')
+                   AND NOT ($4 <= start_time OR $3 >= end_time)`,
+				roomID, bookingID, startTime, endTime,
+			).Scan(&cnt); err != nil {
+				return err
+			}
+			if cnt > 0 {
+				return errTimeSlotConflict
+			}
+		}
+
+		return tx.QueryRow(
+			`UPDATE bookings SET status = $1, start_time = $2, end_time = $3, sequence = sequence + 1
+             WHERE id = $4 RETURNING sequence`,
+			req.Status, startTime, endTime, bookingID,
+		).Scan(&sequence)
+	})
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		a.writeBookingConflictOrError(w, roomID, startTime, endTime, err)
 		return
 	}
 
+	method := "REQUEST"
+	if req.Status == "cancelled" {
+		method = "CANCEL"
+	}
+	a.sendBookingInvite(Booking{
+		ID: bookingID, RoomID: roomID, UserID: ownerID,
+		StartTime: startTime, EndTime: endTime, Status: req.Status, Sequence: sequence,
+	}, method)
+
+	a.Hub.broadcast(roomID, wsEvent{
+		Type:   "booking.updated",
+		RoomID: roomID,
+		Data:   map[string]any{"id": bookingID, "status": req.Status},
+	})
+
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
@@ -670,8 +972,13 @@ func (a *App) handleCancelBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ownerID int64
-	err = a.DB.QueryRow(`SELECT user_id FROM bookings WHERE id = $1`).Scan(&ownerID)
+	var ownerID, roomID int64
+	var seriesID sql.NullInt64
+	var startTime time.Time
+	err = a.DB.QueryRow(
+		`SELECT user_id, room_id, series_id, start_time FROM bookings WHERE id = $1`,
+		bookingID,
+	).Scan(&ownerID, &roomID, &seriesID, &startTime)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "booking not found"})
@@ -686,14 +993,109 @@ func (a *App) handleCancelBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = a.DB.Exec(
-		`UPDATE bookings SET status = 'cancelled' WHERE id = $1`,
-		bookingID,
+	// По умолчанию отменяется только это вхождение. ?scope=following
+	// отменяет его и все последующие вхождения той же серии.
+	scope := r.URL.Query().Get("scope")
+	if scope == "following" && seriesID.Valid {
+		_, err = a.DB.Exec(
+			`UPDATE bookings SET status = 'cancelled' WHERE series_id = $1 AND start_time >= $2`,
+			seriesID.Int64, startTime,
+		)
+	} else {
+		_, err = a.DB.Exec(`UPDATE bookings SET status = 'cancelled' WHERE id = $1`, bookingID)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	a.Hub.broadcast(roomID, wsEvent{
+		Type:   "booking.cancelled",
+		RoomID: roomID,
+		Data:   map[string]any{"id": bookingID},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
+// handleCancelBookingSeries отменяет все вхождения серии повторяющихся
+// броней целиком.
+func (a *App) handleCancelBookingSeries(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	seriesID, err := parseIDParam(r, "seriesID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid series id"})
+		return
+	}
+
+	var roomID int64
+	err = a.DB.QueryRow(`SELECT room_id FROM bookings WHERE id = $1`, seriesID).Scan(&roomID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "series not found"})
+		} else {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		}
+		return
+	}
+
+	if user.Role != "admin" {
+		var ownerCount int
+		err = a.DB.QueryRow(
+			`SELECT count(*) FROM bookings WHERE series_id = $1 AND user_id != $2`,
+			seriesID, user.ID,
+		).Scan(&ownerCount)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+		if ownerCount > 0 {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "access denied"})
+			return
+		}
+	}
+
+	rows, err := a.DB.Query(
+		`UPDATE bookings SET status = 'cancelled' WHERE series_id = $1
+         RETURNING id, user_id, start_time, end_time, sequence`,
+		seriesID,
 	)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
 		return
 	}
+	var cancelled []Booking
+	for rows.Next() {
+		var b Booking
+		if err := rows.Scan(&b.ID, &b.UserID, &b.StartTime, &b.EndTime, &b.Sequence); err != nil {
+			rows.Close()
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+			return
+		}
+		b.RoomID = roomID
+		b.Status = "cancelled"
+		cancelled = append(cancelled, b)
+	}
+	rows.Close()
+	if len(cancelled) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "series not found"})
+		return
+	}
+
+	for _, b := range cancelled {
+		a.sendBookingInvite(b, "CANCEL")
+	}
+
+	a.Hub.broadcast(roomID, wsEvent{
+		Type:   "booking.cancelled",
+		RoomID: roomID,
+		Data:   map[string]any{"series_id": seriesID},
+	})
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Notifier отправляет письмо с приглашением/отменой при создании или
+// изменении брони. method - "REQUEST" или "CANCEL", как в icsBody
+// (уже готовый VCALENDAR с соответствующим METHOD), и должен попасть в
+// Content-Type письма, иначе почтовый клиент примет отмену за обычное
+// приглашение.
+type Notifier interface {
+	SendBookingEmail(ctx context.Context, booking Booking, recipient, method, icsBody string) error
+}
+
+// logNotifier - реализация по умолчанию для прототипа: просто
+// логирует факт отправки вместо настоящего SMTP.
+type logNotifier struct{}
+
+func (logNotifier) SendBookingEmail(_ context.Context, booking Booking, recipient, _, _ string) error {
+	log.Printf("[email] booking notification: booking_id=%d recipient=%s status=%s", booking.ID, recipient, booking.Status)
+	return nil
+}
+
+// smtpNotifier отправляет приглашение через обычный SMTP-relay.
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func newSMTPNotifier() *smtpNotifier {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	from := os.Getenv("SMTP_FROM")
+	user := os.Getenv("SMTP_USER")
+	pass := os.Getenv("SMTP_PASSWORD")
+
+	return &smtpNotifier{
+		addr: fmt.Sprintf("%s:%s", host, port),
+		auth: smtp.PlainAuth("", user, pass, host),
+		from: from,
+	}
+}
+
+func (n *smtpNotifier) SendBookingEmail(_ context.Context, booking Booking, recipient, method, icsBody string) error {
+	subject := fmt.Sprintf("Booking #%d %s", booking.ID, booking.Status)
+	msg := buildMIMEInviteEmail(n.from, recipient, subject, method, icsBody)
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{recipient}, []byte(msg))
+}
+
+// stripCRLF убирает переводы строк из значения, которое пойдет в
+// "сырой" блок заголовков MIME-письма - иначе строка с \r\n внутри
+// добавила бы произвольный заголовок (header injection). Booking.Status
+// валидируется handleUpdateBooking и так ограничен известным набором
+// значений, но это последний рубеж для любого поля, попадающего сюда.
+func stripCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", "")
+}
+
+// buildMIMEInviteEmail собирает минимальное multipart-письмо с
+// вложенным VCALENDAR. Content-Type method= должен совпадать с
+// METHOD внутри icsBody (REQUEST/CANCEL) - почтовые клиенты решают по
+// нему, показывать приглашение или обрабатывать отмену.
+func buildMIMEInviteEmail(from, to, subject, method, icsBody string) string {
+	return fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/calendar; charset=utf-8; method=%s\r\n\r\n%s",
+		stripCRLF(from), stripCRLF(to), stripCRLF(subject), stripCRLF(method), icsBody,
+	)
+}
+
+// newNotifier выбирает реализацию Notifier по переменным окружения:
+// заданный SMTP_HOST включает настоящую отправку почты, иначе
+// используется логирующая заглушка.
+func newNotifier() Notifier {
+	if os.Getenv("SMTP_HOST") != "" {
+		return newSMTPNotifier()
+	}
+	return logNotifier{}
+}
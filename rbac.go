@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Permission - битовая маска прав участника комнаты.
+type Permission int64
+
+const (
+	PermissionView Permission = 1 << iota
+	PermissionBook
+	PermissionManageMembers
+	PermissionManageRoom
+)
+
+// Роли участника комнаты и права, которые им соответствуют по
+// умолчанию при добавлении через POST /api/rooms/{roomID}/members.
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleMember = "member"
+	RoomRoleGuest  = "guest"
+)
+
+func defaultPermissionsForRole(role string) Permission {
+	switch role {
+	case RoomRoleOwner:
+		return PermissionView | PermissionBook | PermissionManageMembers | PermissionManageRoom
+	case RoomRoleMember:
+		return PermissionView | PermissionBook
+	case RoomRoleGuest:
+		return PermissionView
+	default:
+		return 0
+	}
+}
+
+// Room.Visibility
+const (
+	RoomVisibilityPublic     = "public"
+	RoomVisibilityPrivate    = "private"
+	RoomVisibilityInviteOnly = "invite-only"
+)
+
+// RoomMember - строка таблицы room_members.
+type RoomMember struct {
+	RoomID      int64      `json:"room_id"`
+	UserID      int64      `json:"user_id"`
+	Role        string     `json:"role"`
+	Permissions Permission `json:"permissions"`
+	JoinedAt    time.Time  `json:"joined_at"`
+}
+
+type addRoomMemberRequest struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+type updateRoomMemberRequest struct {
+	Role string `json:"role"`
+}
+
+// roomMember загружает членство пользователя в комнате, если оно есть.
+func (a *App) roomMember(userID, roomID int64) (*RoomMember, error) {
+	var m RoomMember
+	err := a.DB.QueryRow(
+		`SELECT room_id, user_id, role, permissions, joined_at FROM room_members WHERE room_id = $1 AND user_id = $2`,
+		roomID, userID,
+	).Scan(&m.RoomID, &m.UserID, &m.Role, &m.Permissions, &m.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// RoomRole возвращает членство пользователя u в комнате roomID, либо
+// sql.ErrNoRows, если пользователь не состоит в ней. Принимает *App,
+// так как проверка требует обращения к БД.
+func (u *AuthUser) RoomRole(a *App, roomID int64) (*RoomMember, error) {
+	return a.roomMember(u.ID, roomID)
+}
+
+// roomVisibility возвращает visibility комнаты.
+func (a *App) roomVisibility(roomID int64) (string, error) {
+	var visibility string
+	err := a.DB.QueryRow(`SELECT visibility FROM rooms WHERE id = $1`, roomID).Scan(&visibility)
+	return visibility, err
+}
+
+// canAccessRoom решает, может ли пользователь видеть/бронировать
+// комнату с данным visibility: публичные комнаты открыты всем,
+// private/invite-only требуют членства (или глобальной роли admin).
+func (a *App) canAccessRoom(user *AuthUser, roomID int64) (bool, error) {
+	visibility, err := a.roomVisibility(roomID)
+	if err != nil {
+		return false, err
+	}
+	if visibility == RoomVisibilityPublic {
+		return true, nil
+	}
+	if user == nil {
+		return false, nil
+	}
+	if user.Role == "admin" {
+		return true, nil
+	}
+	_, err = a.roomMember(user.ID, roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// requireRoomPermission - middleware-фабрика: пропускает запрос только
+// если глобальный admin либо участник комнаты {roomID} с нужным битом
+// в permissions.
+func (a *App) requireRoomPermission(perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := getAuthUser(r)
+			if user == nil {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+			if user.Role == "admin" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			roomID, err := parseIDParam(r, "roomID")
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+				return
+			}
+
+			member, err := user.RoomRole(a, roomID)
+			if errors.Is(err, sql.ErrNoRows) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "not a member of this room"})
+				return
+			}
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+				return
+			}
+			if member.Permissions&perm == 0 {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient room permissions"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ===== Handlers: room members =====
+
+func (a *App) handleAddRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, err := parseIDParam(r, "roomID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return
+	}
+
+	var req addRoomMemberRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Role = strings.ToLower(strings.TrimSpace(req.Role))
+	if req.UserID <= 0 || req.Role == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "user_id and role required"})
+		return
+	}
+	perms := defaultPermissionsForRole(req.Role)
+	if perms == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported role: " + req.Role})
+		return
+	}
+
+	_, err = a.DB.Exec(
+		`INSERT INTO room_members (room_id, user_id, role, permissions) VALUES ($1, $2, $3, $4)`,
+		roomID, req.UserID, req.Role, perms,
+	)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{"room_id": roomID, "user_id": req.UserID, "role": req.Role, "permissions": perms})
+}
+
+func (a *App) handleUpdateRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, err := parseIDParam(r, "roomID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+
+	var req updateRoomMemberRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	req.Role = strings.ToLower(strings.TrimSpace(req.Role))
+	perms := defaultPermissionsForRole(req.Role)
+	if perms == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported role: " + req.Role})
+		return
+	}
+
+	res, err := a.DB.Exec(
+		`UPDATE room_members SET role = $1, permissions = $2 WHERE room_id = $3 AND user_id = $4`,
+		req.Role, perms, roomID, userID,
+	)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "member not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"room_id": roomID, "user_id": userID, "role": req.Role, "permissions": perms})
+}
+
+func (a *App) handleRemoveRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, err := parseIDParam(r, "roomID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return
+	}
+	userID, err := parseIDParam(r, "userID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid user id"})
+		return
+	}
+
+	res, err := a.DB.Exec(`DELETE FROM room_members WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "member not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+// handleRoomMe возвращает членство текущего пользователя в комнате,
+// если оно есть.
+func (a *App) handleRoomMe(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	roomID, err := parseIDParam(r, "roomID")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid room id"})
+		return
+	}
+
+	member, err := user.RoomRole(a, roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not a member of this room"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, member)
+}
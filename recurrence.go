@@ -0,0 +1,319 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rrule - разобранное правило повторения в духе iCalendar RRULE.
+// Поддерживается только необходимый минимум: FREQ, INTERVAL, BYDAY,
+// COUNT, UNTIL. Остальные части (BYMONTH, BYSETPOS и т.д.) не
+// поддерживаются и должны быть отклонены на этапе разбора.
+type rrule struct {
+	Freq     string // DAILY | WEEKLY | MONTHLY
+	Interval int
+	ByDay    []time.Weekday
+	Count    int       // 0, если не задано
+	Until    time.Time // нулевое значение, если не задано
+}
+
+var rruleDayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// parseRRULE разбирает строку вида "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+func parseRRULE(raw string) (*rrule, error) {
+	rule := &rrule{Interval: 1}
+	var sawFreq bool
+
+	for _, part := range strings.Split(raw, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("malformed rrule part: " + part)
+		}
+		key, value := strings.ToUpper(kv[0]), kv[1]
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY":
+				rule.Freq = value
+				sawFreq = true
+			default:
+				return nil, errors.New("unsupported FREQ: " + value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, errors.New("invalid INTERVAL")
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := rruleDayCodes[strings.ToUpper(strings.TrimSpace(code))]
+				if !ok {
+					return nil, errors.New("unsupported BYDAY value: " + code)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, errors.New("invalid COUNT")
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseFlexibleTime(value)
+			if err != nil {
+				return nil, errors.New("invalid UNTIL")
+			}
+			rule.Until = until
+		default:
+			return nil, errors.New("unsupported RRULE part: " + key)
+		}
+	}
+
+	if !sawFreq {
+		return nil, errors.New("FREQ is required")
+	}
+	if rule.Freq != "WEEKLY" && len(rule.ByDay) > 0 {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if rule.Count == 0 && rule.Until.IsZero() {
+		return nil, errors.New("RRULE must specify either COUNT or UNTIL")
+	}
+	return rule, nil
+}
+
+type occurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// expandRRULE раскрывает правило в конкретные вхождения [start, end),
+// [start2, end2), ... Вхождения ограничены COUNT/UNTIL; перебор
+// прекращается не позже maxOccurrences+1 вхождения - это защита от
+// "убегающих" правил. Правило, дающее больше maxOccurrences вхождений,
+// отклоняется с ошибкой, а не обрезается.
+func expandRRULE(rule *rrule, start, end time.Time, maxOccurrences int) ([]occurrence, error) {
+	duration := end.Sub(start)
+	days := rule.ByDay
+	if rule.Freq == "WEEKLY" && len(days) == 0 {
+		days = []time.Weekday{start.Weekday()}
+	}
+
+	var occurrences []occurrence
+	candidate := start
+	for step := 0; len(occurrences) < maxOccurrences+1; step++ {
+		if rule.Freq == "WEEKLY" {
+			// Перебираем каждый день недели внутри интервала, начиная с start.
+			weekStart := candidate.AddDate(0, 0, -int(candidate.Weekday()))
+			if step > 0 {
+				weekStart = weekStart.AddDate(0, 0, 7*rule.Interval)
+			}
+			for _, d := range days {
+				t := time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+				t = t.AddDate(0, 0, int(d))
+				if t.Before(start) {
+					continue
+				}
+				if rule.Count == 0 && !rule.Until.IsZero() && t.After(rule.Until) {
+					continue
+				}
+				occurrences = append(occurrences, occurrence{Start: t, End: t.Add(duration)})
+			}
+			candidate = weekStart
+			if rule.Count == 0 && !rule.Until.IsZero() && weekStart.After(rule.Until) {
+				break
+			}
+			continue
+		}
+
+		if step > 0 {
+			switch rule.Freq {
+			case "DAILY":
+				candidate = candidate.AddDate(0, 0, rule.Interval)
+			case "MONTHLY":
+				// От start, а не от предыдущего candidate: иначе зажатый
+				// день (см. addMonthsClamped) необратимо "съезжает" для
+				// всех последующих вхождений.
+				candidate = addMonthsClamped(start, step*rule.Interval)
+			default:
+				return nil, errors.New("unsupported FREQ: " + rule.Freq)
+			}
+		}
+		if rule.Count == 0 && !rule.Until.IsZero() && candidate.After(rule.Until) {
+			break
+		}
+		occurrences = append(occurrences, occurrence{Start: candidate, End: candidate.Add(duration)})
+	}
+
+	sortOccurrences(occurrences)
+
+	if rule.Count > 0 && len(occurrences) > rule.Count {
+		occurrences = occurrences[:rule.Count]
+	}
+	if len(occurrences) == 0 {
+		return nil, errors.New("rrule produced no occurrences")
+	}
+	if len(occurrences) > maxOccurrences {
+		return nil, errors.New("rrule exceeds maximum allowed occurrences")
+	}
+	return occurrences, nil
+}
+
+// createRecurringBooking раскрывает rawRule в конкретные вхождения и
+// создает их все в одной SERIALIZABLE-транзакции через withSerializableTx
+// (см. db.go) - тот же "check, затем insert" иначе остается racy под
+// нагрузкой для каждого вхождения серии, как и для одиночной брони.
+// Если хотя бы одно вхождение конфликтует с существующей бронью,
+// откатываются все.
+func (a *App) createRecurringBooking(w http.ResponseWriter, r *http.Request, user *AuthUser, roomID int64, start, end time.Time, rawRule string) {
+	rule, err := parseRRULE(rawRule)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid recurrence: " + err.Error()})
+		return
+	}
+
+	occurrences, err := expandRRULE(rule, start, end, a.MaxRecurrenceOccurrences)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid recurrence: " + err.Error()})
+		return
+	}
+
+	var seriesID int64
+	var bookingIDs []int64
+	var conflict *occurrence
+	var conflictIndex int
+
+	err = a.withSerializableTx(r.Context(), func(tx *sql.Tx) error {
+		seriesID = 0
+		bookingIDs = nil
+		conflict = nil
+
+		for i, occ := range occurrences {
+			var cnt int
+			if err := tx.QueryRow(
+				`SELECT count(*)
+                 FROM bookings
+                 WHERE room_id = $1
+                   AND status IN ('pending', 'confirmed')
+                   AND NOT ($3 <= start_time OR $2 >= end_time)`,
+				roomID, occ.Start, occ.End,
+			).Scan(&cnt); err != nil {
+				return err
+			}
+			if cnt > 0 {
+				occ := occ
+				conflict = &occ
+				conflictIndex = i
+				return errTimeSlotConflict
+			}
+
+			var bookingID int64
+			if err := tx.QueryRow(
+				`INSERT INTO bookings (room_id, user_id, start_time, end_time, status, series_id, rrule)
+                 VALUES ($1, $2, $3, $4, 'confirmed', $5, $6) RETURNING id`,
+				roomID, user.ID, occ.Start, occ.End, nullableSeriesID(seriesID), rawRule,
+			).Scan(&bookingID); err != nil {
+				return err
+			}
+
+			if i == 0 {
+				seriesID = bookingID
+				if _, err := tx.Exec(`UPDATE bookings SET series_id = $1 WHERE id = $1`, bookingID); err != nil {
+					return err
+				}
+			}
+			bookingIDs = append(bookingIDs, bookingID)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errTimeSlotConflict) && conflict != nil {
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"error":                  "time slot already booked",
+				"conflicting_occurrence": conflict.Start,
+				"occurrence_index":       conflictIndex,
+			})
+			return
+		}
+		a.writeBookingConflictOrError(w, roomID, occurrences[0].Start, occurrences[len(occurrences)-1].End, err)
+		return
+	}
+
+	log.Printf("[email] recurring booking confirmed: series_id=%d occurrences=%d user_id=%d room_id=%d", seriesID, len(bookingIDs), user.ID, roomID)
+
+	for i, occ := range occurrences {
+		a.sendBookingInvite(Booking{
+			ID: bookingIDs[i], RoomID: roomID, UserID: user.ID,
+			StartTime: occ.Start, EndTime: occ.End, Status: "confirmed",
+		}, "REQUEST")
+	}
+
+	a.Hub.broadcast(roomID, wsEvent{
+		Type:   "booking.created",
+		RoomID: roomID,
+		Data:   map[string]any{"series_id": seriesID, "booking_ids": bookingIDs},
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"series_id":   seriesID,
+		"booking_ids": bookingIDs,
+	})
+}
+
+// nullableSeriesID возвращает nil для первого вхождения серии (до того,
+// как известен id первой строки, которым она сама себя помечает) и сам
+// id для последующих вхождений.
+func nullableSeriesID(seriesID int64) any {
+	if seriesID == 0 {
+		return nil
+	}
+	return seriesID
+}
+
+// addMonthsClamped добавляет months месяцев к t, сохраняя время суток.
+// Если в получившемся месяце меньше дней, чем в t (например, 31 января
+// + 1 месяц = февраль), день "зажимается" до последнего дня того
+// месяца, а не переносится на начало следующего - time.Time.AddDate
+// так и делает (31 января -> 3 марта), из-за чего якорный день
+// необратимо съезжает для всех последующих вхождений серии.
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	totalMonths := int(month) - 1 + months
+	targetYear := year + totalMonths/12
+	targetMonth := time.Month(totalMonths%12 + 1)
+
+	if lastDay := daysInMonth(targetYear, targetMonth); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(targetYear, targetMonth, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func daysInMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func sortOccurrences(occurrences []occurrence) {
+	for i := 1; i < len(occurrences); i++ {
+		for j := i; j > 0 && occurrences[j].Start.Before(occurrences[j-1].Start); j-- {
+			occurrences[j], occurrences[j-1] = occurrences[j-1], occurrences[j]
+		}
+	}
+}
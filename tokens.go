@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// revokedJTICacheSize ограничивает размер in-memory кэша отозванных
+// access-токенов (revokedJTICache).
+const revokedJTICacheSize = 10_000
+
+// loadJWTKeys читает ключи подписи JWT из окружения.
+//
+// JWT_SIGNING_KEYS - список "kid:secret" через запятую, например
+// "2026-01:abc123,2026-07:def456". JWT_ACTIVE_KID выбирает, каким из
+// них подписываются новые токены; остальные остаются пригодными для
+// проверки уже выданных токенов, что и позволяет ротацию без
+// одномоментной инвалидации всех сессий.
+//
+// Для обратной совместимости, если JWT_SIGNING_KEYS не задан,
+// используется одиночный JWT_SECRET под kid "default".
+func loadJWTKeys() (map[string][]byte, string, error) {
+	keys := make(map[string][]byte)
+
+	if raw := os.Getenv("JWT_SIGNING_KEYS"); raw != "" {
+		for _, pair := range strings.Split(raw, ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return nil, "", errors.New("malformed JWT_SIGNING_KEYS entry: " + pair)
+			}
+			keys[kv[0]] = []byte(kv[1])
+		}
+
+		activeKid := os.Getenv("JWT_ACTIVE_KID")
+		if activeKid == "" {
+			return nil, "", errors.New("JWT_ACTIVE_KID is required when JWT_SIGNING_KEYS is set")
+		}
+		if _, ok := keys[activeKid]; !ok {
+			return nil, "", errors.New("JWT_ACTIVE_KID not present in JWT_SIGNING_KEYS")
+		}
+		return keys, activeKid, nil
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, "", errors.New("neither JWT_SIGNING_KEYS nor JWT_SECRET is set")
+	}
+	keys["default"] = []byte(secret)
+	return keys, "default", nil
+}
+
+// Время жизни access- и refresh-токенов. Access-токен короткоживущий,
+// чтобы утечка не давала злоумышленнику долгий доступ; refresh-токен
+// живет долго, но хранится в БД и может быть отозван.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// revokedJTICache - небольшой ограниченный по размеру кэш отозванных
+// access-токенов (по claim jti) для немедленного "выключателя" между
+// refresh/logout и естественным истечением 15-минутного токена. При
+// переполнении вытесняется запись, добавленная раньше всех; проверки
+// через isRevoked и повторный revoke того же jti ее позицию в очереди
+// вытеснения не меняют.
+type revokedJTICache struct {
+	mu    sync.Mutex
+	max   int
+	order []string
+	until map[string]time.Time
+}
+
+func newRevokedJTICache(max int) *revokedJTICache {
+	return &revokedJTICache{max: max, until: make(map[string]time.Time)}
+}
+
+func (c *revokedJTICache) revoke(jti string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.until[jti]; !exists {
+		c.order = append(c.order, jti)
+	}
+	c.until[jti] = expiresAt
+	for len(c.order) > c.max {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.until, oldest)
+	}
+}
+
+func (c *revokedJTICache) isRevoked(jti string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt, ok := c.until[jti]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiresAt) {
+		delete(c.until, jti)
+		return false
+	}
+	return true
+}
+
+// generateTokenID возвращает случайный hex-идентификатор, используемый
+// как jti access-токена.
+func generateTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// generateRefreshSecret возвращает случайный refresh-токен, который
+// отдается клиенту. В БД хранится только его hash.
+func generateRefreshSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// mintAccessToken подписывает короткоживущий JWT активным ключом
+// (kid). jti попадает в claims, чтобы его можно было мгновенно
+// отозвать через RevokedJTIs, не дожидаясь истечения срока действия.
+func (a *App) mintAccessToken(userID int64, role string) (tokenStr string, jti string, expiresAt time.Time, err error) {
+	jti, err = generateTokenID()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	expiresAt = time.Now().Add(accessTokenTTL)
+	claims := &Claims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = a.JWTActiveKid
+
+	key, ok := a.JWTKeys[a.JWTActiveKid]
+	if !ok {
+		return "", "", time.Time{}, errors.New("active signing key not configured")
+	}
+	tokenStr, err = token.SignedString(key)
+	return tokenStr, jti, expiresAt, err
+}
+
+// issueTokenPair mints a fresh access/refresh pair for userID and
+// persists the refresh token (hashed) tied to the request's user
+// agent / IP for auditing.
+func (a *App) issueTokenPair(r *http.Request, userID int64, role string) (accessToken, refreshToken string, err error) {
+	accessToken, jti, _, err := a.mintAccessToken(userID, role)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err = generateRefreshSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = a.DB.Exec(
+		`INSERT INTO refresh_tokens (user_id, token_hash, access_jti, expires_at, user_agent, ip)
+         VALUES ($1, $2, $3, $4, $5, $6)`,
+		userID, hashRefreshToken(refreshToken), jti, time.Now().Add(refreshTokenTTL), r.UserAgent(), clientIP(r),
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return fwd
+	}
+	return r.RemoteAddr
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// handleRefresh меняет предъявленный refresh-токен на новую пару
+// access+refresh, инвалидируя старую строку. Если предъявленный токен
+// уже был отозван ранее (повторное использование украденного
+// refresh-токена), отзываются все активные refresh-токены
+// пользователя.
+//
+// Проверка "не отозван ли уже" и его отзыв выполняются одним атомарным
+// UPDATE ... WHERE revoked_at IS NULL RETURNING (как в handleLogout),
+// а не отдельными SELECT и UPDATE - иначе два параллельных запроса с
+// одним и тем же токеном оба прочитают revoked_at IS NULL и оба
+// получат новую пару токенов, что и должна была исключать проверка на
+// повторное использование.
+func (a *App) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "refresh_token required"})
+		return
+	}
+
+	tokenHash := hashRefreshToken(req.RefreshToken)
+
+	var (
+		userID    int64
+		role      string
+		accessJTI string
+	)
+	err := a.DB.QueryRow(
+		`UPDATE refresh_tokens rt SET revoked_at = now()
+         FROM users u
+         WHERE rt.token_hash = $1
+           AND u.id = rt.user_id
+           AND rt.revoked_at IS NULL
+           AND rt.expires_at > now()
+         RETURNING rt.user_id, u.role, rt.access_jti`,
+		tokenHash,
+	).Scan(&userID, &role, &accessJTI)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			a.writeRefreshFailure(w, tokenHash)
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	a.RevokedJTIs.revoke(accessJTI, time.Now().Add(accessTokenTTL))
+
+	accessToken, refreshToken, err := a.issueTokenPair(r, userID, role)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, refreshResponse{Token: accessToken, RefreshToken: refreshToken})
+}
+
+// writeRefreshFailure определяет, почему атомарный UPDATE в
+// handleRefresh не затронул ни одной строки (токен никогда не
+// существовал, уже был отозван - похоже на кражу, - либо истек), и
+// отвечает клиенту соответствующим сообщением. Если токен уже был
+// отозван ранее (повторное использование), эта функция сама отзывает
+// все сессии пользователя через revokeAllSessions; в остальных случаях
+// она только выбирает текст ошибки.
+func (a *App) writeRefreshFailure(w http.ResponseWriter, tokenHash string) {
+	var (
+		userID    int64
+		revokedAt sql.NullTime
+	)
+	err := a.DB.QueryRow(
+		`SELECT user_id, revoked_at FROM refresh_tokens WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&userID, &revokedAt)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid refresh token"})
+		return
+	}
+	if revokedAt.Valid {
+		// Токен уже был использован/отозван ранее - похоже на кражу.
+		// Отзываем все refresh-токены и access-jti пользователя.
+		a.revokeAllSessions(userID)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "refresh token reuse detected, all sessions revoked"})
+		return
+	}
+	writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "refresh token expired"})
+}
+
+// handleLogout отзывает предъявленный refresh-токен и связанный с ним
+// access-jti.
+func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.RefreshToken == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "refresh_token required"})
+		return
+	}
+
+	tokenHash := hashRefreshToken(req.RefreshToken)
+
+	var accessJTI string
+	err := a.DB.QueryRow(
+		`UPDATE refresh_tokens SET revoked_at = now()
+         WHERE token_hash = $1 AND revoked_at IS NULL
+         RETURNING access_jti`,
+		tokenHash,
+	).Scan(&accessJTI)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	if accessJTI != "" {
+		a.RevokedJTIs.revoke(accessJTI, time.Now().Add(accessTokenTTL))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "logged out"})
+}
+
+// revokeAllSessions отзывает все активные refresh-токены пользователя
+// и их access-jti - используется при обнаружении повторного
+// использования refresh-токена.
+func (a *App) revokeAllSessions(userID int64) {
+	rows, err := a.DB.Query(
+		`UPDATE refresh_tokens SET revoked_at = now()
+         WHERE user_id = $1 AND revoked_at IS NULL
+         RETURNING access_jti`,
+		userID,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jti string
+		if err := rows.Scan(&jti); err == nil && jti != "" {
+			a.RevokedJTIs.revoke(jti, time.Now().Add(accessTokenTTL))
+		}
+	}
+}
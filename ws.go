@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsWriteTimeout - сколько ждем, прежде чем считать клиента "медленным"
+// и разорвать соединение, чтобы не копить неограниченную очередь.
+const wsWriteTimeout = 5 * time.Second
+
+// wsOutboxSize - размер буфера исходящих сообщений на одно соединение.
+const wsOutboxSize = 32
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// wsSubscribeFrame - то, что клиент присылает, чтобы подписаться на
+// обновления конкретной комнаты.
+type wsSubscribeFrame struct {
+	Type   string `json:"type"`
+	RoomID int64  `json:"room_id"`
+}
+
+// wsEvent - то, что сервер рассылает подписчикам комнаты.
+type wsEvent struct {
+	Type   string `json:"type"`
+	RoomID int64  `json:"room_id"`
+	Data   any    `json:"data,omitempty"`
+}
+
+// Hub держит набор подписчиков на каждую комнату и рассылает им
+// события вроде booking.created/booking.cancelled/room.updated.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[int64]map[*wsClient]struct{}
+}
+
+func newHub() *Hub {
+	return &Hub{clients: make(map[int64]map[*wsClient]struct{})}
+}
+
+func (h *Hub) subscribe(c *wsClient, roomID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[roomID] == nil {
+		h.clients[roomID] = make(map[*wsClient]struct{})
+	}
+	h.clients[roomID][c] = struct{}{}
+}
+
+func (h *Hub) unsubscribeAll(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for roomID, subs := range h.clients {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.clients, roomID)
+		}
+	}
+}
+
+// broadcast рассылает событие всем подписчикам комнаты. Медленные
+// клиенты (чей буфер переполнен) отключаются вместо того, чтобы
+// блокировать рассылку остальным.
+func (h *Hub) broadcast(roomID int64, event wsEvent) {
+	h.mu.RLock()
+	subs := make([]*wsClient, 0, len(h.clients[roomID]))
+	for c := range h.clients[roomID] {
+		subs = append(subs, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range subs {
+		select {
+		case c.outbox <- event:
+		default:
+			c.close()
+		}
+	}
+}
+
+// wsClient - одно подключенное WebSocket-соединение.
+type wsClient struct {
+	app    *App
+	hub    *Hub
+	conn   *websocket.Conn
+	user   *AuthUser
+	outbox chan wsEvent
+
+	closeOnce sync.Once
+}
+
+func newWSClient(app *App, hub *Hub, conn *websocket.Conn, user *AuthUser) *wsClient {
+	return &wsClient{
+		app:    app,
+		hub:    hub,
+		conn:   conn,
+		user:   user,
+		outbox: make(chan wsEvent, wsOutboxSize),
+	}
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		c.hub.unsubscribeAll(c)
+		_ = c.conn.Close()
+	})
+}
+
+// writeLoop пишет исходящие события клиенту, пока outbox не закроется
+// или запись не зависнет дольше wsWriteTimeout.
+func (c *wsClient) writeLoop() {
+	defer c.close()
+	for event := range c.outbox {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+}
+
+// readLoop разбирает входящие subscribe-фреймы, пока соединение живо.
+// Подписка на private/invite-only комнату требует того же доступа, что
+// и REST-эндпоинты (canAccessRoom) - иначе держатель любого валидного
+// JWT мог бы слушать события чужой закрытой комнаты.
+func (c *wsClient) readLoop() {
+	defer c.close()
+	for {
+		var frame wsSubscribeFrame
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		if frame.Type == "subscribe" && frame.RoomID > 0 {
+			if allowed, err := c.app.canAccessRoom(c.user, frame.RoomID); err != nil || !allowed {
+				continue
+			}
+			c.hub.subscribe(c, frame.RoomID)
+		}
+	}
+}
+
+// handleWS апгрейдит соединение до WebSocket и подписывает клиента на
+// события выбранных им комнат. Браузеры не могут отправить заголовок
+// Authorization при установлении WS-соединения, поэтому токен также
+// принимается через Sec-WebSocket-Protocol либо query-параметр token.
+func (a *App) handleWS(w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.URL.Query().Get("token")
+	if tokenStr == "" {
+		tokenStr = r.Header.Get("Sec-WebSocket-Protocol")
+	}
+	if tokenStr == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "token required"})
+		return
+	}
+
+	user, err := a.parseAccessToken(tokenStr)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+		return
+	}
+
+	responseHeader := http.Header{}
+	if protocol := r.Header.Get("Sec-WebSocket-Protocol"); protocol != "" {
+		responseHeader.Set("Sec-WebSocket-Protocol", protocol)
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return
+	}
+
+	client := newWSClient(a, a.Hub, conn, user)
+	go client.writeLoop()
+	client.readLoop()
+}